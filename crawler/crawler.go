@@ -0,0 +1,567 @@
+// Package crawler implements the link-following logic of grapher: it
+// scrapes a domain, tracks what has been visited, and builds up the graph
+// of results. Crawl state is persisted to an on-disk store so a crawl can
+// be resumed, and a WARC writer can optionally archive every response.
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Binaryblade/go-grapher/store"
+	"github.com/Binaryblade/go-grapher/warc"
+)
+
+// ScrapeResult carries the links found on a page plus the raw response, so
+// callers such as the WARC writer can archive exactly what was fetched
+type ScrapeResult struct {
+	Links    []Link
+	Response *http.Response
+	Bytes    int64 //size of the body actually read, after the MaxBodyBytes cap
+}
+
+// takes a resource name, opens it and returns everything found within
+type Scraper interface {
+	Scrape(string) (*ScrapeResult, error)
+}
+
+// DomainScraper scrapes pages within a single domain, honoring the
+// politeness settings it was built with
+type DomainScraper struct {
+	domain    string
+	client    *http.Client
+	settings  CrawlSettings
+	polite    *politeness
+	extractor LinkExtractor
+}
+
+// creates a new domain scraper to look for all links in an environment
+func NewDomainScraper(domainname string, settings CrawlSettings) DomainScraper {
+	client := &http.Client{Timeout: settings.FetchTimeout}
+	return DomainScraper{
+		domain:    domainname,
+		client:    client,
+		settings:  settings,
+		polite:    newPoliteness(client, settings),
+		extractor: NewLinkExtractor(),
+	}
+}
+
+func (d DomainScraper) String() string {
+	return d.domain
+}
+
+func (d DomainScraper) Scrape(name string) (*ScrapeResult, error) {
+
+	//build up the full web address
+	toScrape, _ := d.filter(name)
+
+	//skip anything the robots.txt "User-agent: *" group disallows
+	if !d.polite.Allowed(toScrape) {
+		return &ScrapeResult{}, nil
+	}
+
+	if u, err := url.Parse(toScrape); err == nil {
+		d.polite.Wait(u.Host) //enforce the per-host politeness delay
+	}
+
+	//preflight with a HEAD so we don't download and tokenize bodies the
+	//extractor can't read; if HEAD isn't supported, fall through and gate
+	//on the GET's own Content-Type instead. Skipping the GET here means
+	//this response never reaches archive/recordMeta, so a HEAD-skipped
+	//asset isn't written to the WARC and keeps a zero-valued Status and
+	//ContentType in the graph's node metadata
+	if contentType, err := d.headContentType(toScrape); err == nil && contentType != "" && !isExtractable(contentType) {
+		return &ScrapeResult{}, nil //still a graph node, just never scraped
+	}
+
+	req, err := http.NewRequest("GET", toScrape, nil)
+	if err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+	req.Header.Set("User-Agent", d.settings.UserAgent)
+
+	//go get the page
+	resp, err := d.client.Do(req)
+	if err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	//buffer the body so both the tokenizer and a WARC writer can read it
+	//later, capped so one huge response can't stall a worker; this runs
+	//for every Content-Type, extractable or not, so archive/recordMeta
+	//always have a readable body to work with instead of the one resp.Body
+	//already closed by the defer above
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, d.settings.MaxBodyBytes))
+	if err != nil {
+		log.Print(err.Error())
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	contentType := resp.Header.Get("Content-Type")
+	if !isExtractable(contentType) {
+		return &ScrapeResult{Response: resp, Bytes: int64(len(body))}, nil
+	}
+
+	//pull every link out of the body, tagged primary (anchors) or related
+	//(images, scripts, stylesheets, CSS url(...) references)
+	found := d.extractor.Extract(body, contentType)
+
+	//default empty but preallocate room for some typical amount of links
+	links := make([]Link, 0, len(found))
+	for _, l := range found {
+		//run it through a check to make sure it is the current domain
+		mod, good := d.filter(l.URL)
+		if good {
+			links = append(links, Link{URL: mod, Type: l.Type}) //keep valid links only
+		}
+	}
+	return &ScrapeResult{Links: links, Response: resp, Bytes: int64(len(body))}, nil
+}
+
+// headContentType issues a HEAD request and returns the Content-Type it
+// reports, without downloading the body
+func (d DomainScraper) headContentType(toScrape string) (string, error) {
+	req, err := http.NewRequest("HEAD", toScrape, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", d.settings.UserAgent)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("HEAD %s: %s", toScrape, resp.Status)
+	}
+	return resp.Header.Get("Content-Type"), nil
+}
+
+// isExtractable reports whether a Content-Type header value is one the
+// LinkExtractor knows how to read (text/html or text/css), ignoring any
+// charset or other parameters
+func isExtractable(contentType string) bool {
+	ct := strings.TrimSpace(contentType)
+	return strings.HasPrefix(ct, "text/html") || strings.HasPrefix(ct, "text/css")
+}
+
+// Returns true if name is on the same registrable domain as the scraper,
+// so subdomains (blog.example.com alongside example.com) are in scope and
+// Crawler.MaxSubdomains has something to cap
+func (d DomainScraper) filter(name string) (string, bool) {
+	target, err := url.Parse(name)
+	if err != nil {
+		return "", false
+	}
+	domain := &url.URL{Scheme: "http", Host: d.domain}
+	abs := domain.ResolveReference(target)
+	return abs.String(), registrableDomain(abs.Host) == registrableDomain(domain.Host)
+}
+
+// registrableDomain reduces host to its last two labels, a naive
+// approximation of the registrable domain (example.com out of
+// blog.example.com) that doesn't need a public-suffix list
+func registrableDomain(host string) string {
+	host = strings.ToLower(host)
+	labels := strings.Split(host, ".")
+	if len(labels) <= 2 {
+		return host
+	}
+	return strings.Join(labels[len(labels)-2:], ".")
+}
+
+// crawlRequest is a pending fetch, carrying the depth it was discovered at
+// (so Crawl can drop anything past MaxDepth) and whether it was reached via
+// a primary or related link (so related assets aren't recursed into)
+type crawlRequest struct {
+	url      string
+	depth    int
+	linkType LinkType
+}
+
+// holder to return the results of the page scan
+type response struct {
+	site     string
+	depth    int
+	linkType LinkType
+	result   *ScrapeResult
+}
+
+// Crawler object to coordinate the scan
+type Crawler struct {
+	Results     map[string][]string  //result set of connection
+	Meta        map[string]*NodeMeta //per-node metadata used when marshaling the graph
+	Scraper     DomainScraper        //scrapper object that does the work of scanning each page
+	Concurrency int
+
+	MaxDepth       int              //stop following links past this depth; 0 means unlimited
+	MaxPages       int              //stop discovering new pages once this many are visited; 0 means unlimited
+	MaxSubdomains  int              //cap the number of distinct hosts visited; 0 means unlimited
+	Excludes       []*regexp.Regexp //links matching any of these are dropped
+	ExcludeRelated bool             //skip related assets (images, scripts, stylesheets) entirely
+
+	resume         bool
+	store          *store.Store
+	warc           *warc.Writer
+	warcFd         *os.File
+	pagesVisited   int
+	seenSubdomains map[string]bool
+}
+
+// NewCrawler builds a Crawler backed by a BoltDB file at dbPath. When resume
+// is true it reopens dbPath and continues from the saved queue and results
+// instead of starting a fresh crawl of site; site may be left empty on
+// resume, in which case the domain saved by the original crawl is used.
+// settings controls how polite the scraper is towards the hosts it fetches
+// from
+func NewCrawler(site string, count int, dbPath string, resume bool, settings CrawlSettings) (*Crawler, error) {
+	st, err := store.Open(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if resume && site == "" {
+		saved, err := st.Domain()
+		if err != nil {
+			return nil, err
+		}
+		if saved == "" {
+			return nil, fmt.Errorf("crawler: -resume needs a basehost; %s has no previously saved domain", dbPath)
+		}
+		site = saved
+	}
+	if err := st.SaveDomain(site); err != nil {
+		return nil, err
+	}
+
+	crawl := &Crawler{
+		Scraper:        NewDomainScraper(site, settings),
+		Results:        make(map[string][]string),
+		Meta:           make(map[string]*NodeMeta),
+		Concurrency:    count,
+		resume:         resume,
+		store:          st,
+		seenSubdomains: make(map[string]bool),
+	}
+	return crawl, nil
+}
+
+// EnableWarc turns on WARC archiving, writing a gzipped WARC 1.0 record for
+// every scraped response to path
+func (c *Crawler) EnableWarc(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	c.warcFd = f
+	c.warc = warc.NewWriter(f)
+	return nil
+}
+
+// Close flushes the WARC writer, if any, and closes the backing store
+func (c *Crawler) Close() error {
+	var err error
+	if c.warc != nil {
+		if e := c.warc.Close(); e != nil {
+			err = e
+		}
+	}
+	if c.warcFd != nil {
+		if e := c.warcFd.Close(); e != nil {
+			err = e
+		}
+	}
+	if e := c.store.Close(); e != nil {
+		err = e
+	}
+	return err
+}
+
+func (c *Crawler) addResponse(site string, depth int, linkType LinkType, result *ScrapeResult) []crawlRequest {
+	output := make([]string, 0)
+
+	//use a map as a uniqueness filter, keyed on url, remembering the type
+	unique_filter := make(map[string]LinkType)
+	for _, l := range result.Links {
+		if c.ExcludeRelated && l.Type == LinkTypeRelated {
+			continue
+		}
+		unique_filter[l.URL] = l.Type
+	}
+
+	//extract unique results from map
+	for k := range unique_filter {
+		output = append(output, k)
+	}
+
+	//Store results of this scan
+	c.Results[site] = output
+	if err := c.store.SaveResult(site, output); err != nil {
+		log.Print(err)
+	}
+	c.recordMeta(site, result)
+	c.pagesVisited++
+
+	retval := make([]crawlRequest, 0)
+	if linkType == LinkTypeRelated {
+		return retval //a related asset is fetched once, never recursed into
+	}
+	if c.MaxDepth > 0 && depth >= c.MaxDepth {
+		return retval //links found this deep are out of scope
+	}
+	if c.MaxPages > 0 && c.pagesVisited >= c.MaxPages {
+		return retval //already visited as many pages as we're allowed
+	}
+
+	//filter for results not already scanned
+	for v, t := range unique_filter {
+		if _, ok := c.Results[v]; ok {
+			continue
+		}
+		if !c.inScope(v) {
+			continue
+		}
+		if d, ok := c.Scraper.filter(v); ok {
+			retval = append(retval, crawlRequest{url: d, depth: depth + 1, linkType: t})
+		}
+	}
+
+	return retval
+}
+
+// inScope applies the Excludes patterns and the MaxSubdomains cap to a
+// candidate link, on top of the domain check already done by filter
+func (c *Crawler) inScope(rawurl string) bool {
+	for _, re := range c.Excludes {
+		if re.MatchString(rawurl) {
+			return false
+		}
+	}
+
+	if c.MaxSubdomains > 0 {
+		u, err := url.Parse(rawurl)
+		if err == nil && !c.seenSubdomains[u.Host] {
+			if len(c.seenSubdomains) >= c.MaxSubdomains {
+				return false
+			}
+			c.seenSubdomains[u.Host] = true
+		}
+	}
+
+	return true
+}
+
+// seed populates the pending queue, either with the saved queue and results
+// from a previous run (resume) or with the scraper's root site
+func (c *Crawler) seed(reqChan chan<- crawlRequest, pr *sync.WaitGroup) {
+	if c.resume {
+		results, err := c.store.Results()
+		if err != nil {
+			log.Print(err)
+		} else {
+			c.Results = results
+		}
+		pending, err := c.store.Pending()
+		if err != nil {
+			log.Print(err)
+			return
+		}
+		//hosts already visited or queued count towards MaxSubdomains again
+		for site := range c.Results {
+			if u, err := url.Parse(site); err == nil {
+				c.seenSubdomains[u.Host] = true
+			}
+		}
+		for _, item := range pending {
+			if u, err := url.Parse(item.URL); err == nil {
+				c.seenSubdomains[u.Host] = true
+			}
+			pr.Add(1)
+			reqChan <- crawlRequest{url: item.URL, depth: item.Depth, linkType: LinkType(item.LinkType)}
+		}
+		return
+	}
+
+	root := "http://" + c.Scraper.String()
+	c.seenSubdomains[c.Scraper.String()] = true //the root host counts towards MaxSubdomains
+	if err := c.store.Enqueue(store.QueueItem{URL: root, Depth: 0, LinkType: int(LinkTypePrimary)}); err != nil {
+		log.Print(err)
+	}
+	pr.Add(1)
+	reqChan <- crawlRequest{url: root, depth: 0, linkType: LinkTypePrimary}
+}
+
+// Scan the domain
+func (c *Crawler) Crawl() {
+
+	var pr sync.WaitGroup
+	var workers sync.WaitGroup
+
+	//Fill a large enough buffer to hold pending responses
+	reqChan := make(chan crawlRequest, 100e6)
+
+	//channel to funnel results
+	respChan := make(chan response)
+
+	c.seed(reqChan, &pr) //Push the saved queue, or the base site on a fresh crawl
+
+	//Spin off a closer, will return when wait group is empty
+	go func() { pr.Wait(); close(reqChan) }()
+
+	//Spin up a bunch of simultaneous parsers and readers
+	workers.Add(c.Concurrency)
+	for i := 0; i < c.Concurrency; i++ {
+		go func() {
+			defer workers.Done()
+			for {
+				//pull requests and close if no more
+				t, ok := <-reqChan
+				if !ok {
+					return
+				}
+				//report results
+				result, err := c.Scraper.Scrape(t.url)
+				if err != nil {
+					result = &ScrapeResult{}
+				}
+				respChan <- response{site: t.url, depth: t.depth, linkType: t.linkType, result: result}
+			}
+		}()
+	}
+
+	//when the workers are finished kill the response channel
+	go func() { workers.Wait(); close(respChan) }()
+
+	//Spin up a quick logger that reports the queue length
+	durationTick := time.Tick(time.Second)
+	go func() {
+		for range durationTick {
+			log.Printf("Currently %d items in queue\n", len(reqChan))
+		}
+	}()
+
+	//Actually deal with the data coming back from the scrapers
+	for {
+		resp, ok := <-respChan // pull reponses
+		if !ok {
+			break
+		}
+
+		if c.warc != nil && resp.result.Response != nil {
+			c.archive(resp.site, resp.result.Response)
+		}
+
+		//push the collected links and get the unique ones back
+		subset := c.addResponse(resp.site, resp.depth, resp.linkType, resp.result)
+
+		if err := c.store.Dequeue(resp.site); err != nil {
+			log.Print(err)
+		}
+
+		//Queue up a job to scan unique reponses which came back
+		for _, v := range subset {
+			pr.Add(1) //insert all the new requests and increment pending
+			item := store.QueueItem{URL: v.url, Depth: v.depth, LinkType: int(v.linkType)}
+			if err := c.store.Enqueue(item); err != nil {
+				log.Print(err)
+			}
+			reqChan <- v
+		}
+		pr.Done() //Finish serviceing this request
+	}
+
+	c.compressResults()
+}
+
+// archive dumps resp as a raw HTTP message and appends it to the WARC file
+func (c *Crawler) archive(site string, resp *http.Response) {
+	raw, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	if err := c.warc.WriteResponse(site, raw); err != nil {
+		log.Print(err)
+	}
+}
+
+func (c *Crawler) compressResults() {
+	for k, v := range c.Results {
+		c.Results[k] = c.filterLinks(v)
+	}
+	c.annotateGraph()
+}
+
+// recordMeta captures what we learned about site from its scrape, for use
+// when marshaling the graph
+func (c *Crawler) recordMeta(site string, result *ScrapeResult) {
+	meta := &NodeMeta{URL: site, Bytes: result.Bytes}
+	if result.Response != nil {
+		meta.Status = result.Response.StatusCode
+		meta.ContentType = result.Response.Header.Get("Content-Type")
+	}
+	c.Meta[site] = meta
+}
+
+// annotateGraph fills in each node's in/out-degree and PageRank once the
+// final, compressed edge list is known
+func (c *Crawler) annotateGraph() {
+	for node, out := range c.Results {
+		meta := c.Meta[node]
+		if meta == nil {
+			meta = &NodeMeta{URL: node}
+			c.Meta[node] = meta
+		}
+		meta.OutDegree = len(out)
+	}
+	for _, out := range c.Results {
+		for _, dest := range out {
+			if meta, ok := c.Meta[dest]; ok {
+				meta.InDegree++
+			}
+		}
+	}
+
+	for node, rank := range pageRank(c.Results) {
+		if meta, ok := c.Meta[node]; ok {
+			meta.PageRank = rank
+		}
+	}
+}
+
+func (c *Crawler) filterLinks(links []string) []string {
+	retval := make([]string, 0)
+	for _, v := range links {
+		if _, ok := c.Results[v]; ok {
+			retval = append(retval, v)
+		}
+	}
+	return retval
+}
+
+// Implement the Stringer interface
+// default string output is dot file format
+func (c *Crawler) String() string {
+	var buf bytes.Buffer
+	if err := c.Marshal(&buf, "dot"); err != nil {
+		log.Print(err)
+	}
+	return buf.String()
+}
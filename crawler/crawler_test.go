@@ -0,0 +1,109 @@
+package crawler
+
+import (
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/Binaryblade/go-grapher/store"
+)
+
+func newTestCrawler(t *testing.T) *Crawler {
+	t.Helper()
+	st, err := store.Open(filepath.Join(t.TempDir(), "crawl.db"))
+	if err != nil {
+		t.Fatalf("store.Open: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+
+	return &Crawler{
+		Results:        make(map[string][]string),
+		Meta:           make(map[string]*NodeMeta),
+		Scraper:        NewDomainScraper("example.com", DefaultCrawlSettings()),
+		store:          st,
+		seenSubdomains: make(map[string]bool),
+	}
+}
+
+func TestFilterHostPort(t *testing.T) {
+	// a bare "host:port" basehost (e.g. "127.0.0.1:8080") makes url.Parse
+	// treat the port as an invalid scheme; filter must not panic on it
+	d := NewDomainScraper("127.0.0.1:8080", DefaultCrawlSettings())
+
+	abs, ok := d.filter("/page")
+	if !ok || abs != "http://127.0.0.1:8080/page" {
+		t.Fatalf("filter(/page) = %q, %v", abs, ok)
+	}
+}
+
+func TestInScopeExcludes(t *testing.T) {
+	c := newTestCrawler(t)
+	c.Excludes = []*regexp.Regexp{regexp.MustCompile(`/admin`)}
+
+	if c.inScope("http://example.com/admin/page") {
+		t.Error("want /admin/page excluded")
+	}
+	if !c.inScope("http://example.com/page") {
+		t.Error("want /page in scope")
+	}
+}
+
+func TestInScopeMaxSubdomains(t *testing.T) {
+	c := newTestCrawler(t)
+	c.MaxSubdomains = 1
+
+	if !c.inScope("http://a.example.com/") {
+		t.Fatal("want the first subdomain seen to be in scope")
+	}
+	if c.inScope("http://b.example.com/") {
+		t.Fatal("want a second subdomain to exceed MaxSubdomains")
+	}
+	if !c.inScope("http://a.example.com/other") {
+		t.Fatal("want a page on an already-seen subdomain still in scope")
+	}
+}
+
+func TestAddResponseStopsAtMaxDepth(t *testing.T) {
+	c := newTestCrawler(t)
+	c.MaxDepth = 1
+
+	result := &ScrapeResult{Links: []Link{{URL: "http://example.com/p2", Type: LinkTypePrimary}}}
+	reqs := c.addResponse("http://example.com/p1", 1, LinkTypePrimary, result)
+	if len(reqs) != 0 {
+		t.Fatalf("want no new requests past MaxDepth, got %+v", reqs)
+	}
+}
+
+func TestAddResponseStopsAtMaxPages(t *testing.T) {
+	c := newTestCrawler(t)
+	c.MaxPages = 1
+
+	result := &ScrapeResult{Links: []Link{{URL: "http://example.com/p2", Type: LinkTypePrimary}}}
+	reqs := c.addResponse("http://example.com/p1", 0, LinkTypePrimary, result)
+	if len(reqs) != 0 {
+		t.Fatalf("want no new requests once MaxPages is reached, got %+v", reqs)
+	}
+}
+
+func TestAddResponseQueuesInScopeLinks(t *testing.T) {
+	c := newTestCrawler(t)
+
+	result := &ScrapeResult{Links: []Link{{URL: "http://example.com/p2", Type: LinkTypePrimary}}}
+	reqs := c.addResponse("http://example.com/p1", 0, LinkTypePrimary, result)
+	if len(reqs) != 1 {
+		t.Fatalf("want one new request, got %+v", reqs)
+	}
+	if reqs[0].url != "http://example.com/p2" || reqs[0].depth != 1 {
+		t.Fatalf("want p2 queued at depth 1, got %+v", reqs[0])
+	}
+}
+
+func TestAddResponseRelatedLinksAreNotRecursedInto(t *testing.T) {
+	c := newTestCrawler(t)
+
+	result := &ScrapeResult{Links: []Link{{URL: "http://example.com/logo.png", Type: LinkTypeRelated}}}
+	reqs := c.addResponse("http://example.com/logo.png", 0, LinkTypeRelated, result)
+	if len(reqs) != 0 {
+		t.Fatalf("want a related asset to not be recursed into, got %+v", reqs)
+	}
+}
@@ -0,0 +1,118 @@
+package crawler
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// LinkType classifies a link found on a page: whether it should be
+// followed for further crawling, or is merely an asset the page depends on
+type LinkType int
+
+const (
+	LinkTypePrimary LinkType = iota //an HTML anchor; followed for crawling
+	LinkTypeRelated                 //an asset (image, script, stylesheet...); fetched once but not recursed
+)
+
+// Link is a single reference extracted from a page, tagged by LinkType
+type Link struct {
+	URL  string
+	Type LinkType
+}
+
+// LinkExtractor pulls the links out of a fetched body. contentType is the
+// response's Content-Type header, used to tell HTML from CSS bodies
+type LinkExtractor interface {
+	Extract(body []byte, contentType string) []Link
+}
+
+// NewLinkExtractor returns the default extractor: HTML anchors, <link>,
+// <img>, <script>, <iframe>, and CSS url(...) references
+func NewLinkExtractor() LinkExtractor {
+	return defaultExtractor{}
+}
+
+type defaultExtractor struct{}
+
+// cssURLPattern matches url(...) references inside @import and property
+// declarations, e.g. background: url("foo.png") or @import url(foo.css)
+var cssURLPattern = regexp.MustCompile(`(?:@import|:).*url\(["']?([^'"\)]+)["']?\)`)
+
+func (defaultExtractor) Extract(body []byte, contentType string) []Link {
+	if strings.HasPrefix(contentType, "text/css") {
+		return extractCSSLinks(body)
+	}
+	return extractHTMLLinks(body)
+}
+
+// extractHTMLLinks walks the token stream once, pulling anchor hrefs as
+// LinkTypePrimary and every asset reference (including inline <style>
+// blocks) as LinkTypeRelated
+func extractHTMLLinks(body []byte) []Link {
+	links := make([]Link, 0)
+	z := html.NewTokenizer(bytes.NewReader(body))
+
+	var inStyle bool
+	var style bytes.Buffer
+
+	for {
+		t := z.Next()
+		if t == html.ErrorToken {
+			break
+		}
+		token := z.Token()
+		switch token.Type {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			switch token.DataAtom {
+			case atom.A:
+				if href, ok := attr(token, "href"); ok {
+					links = append(links, Link{URL: href, Type: LinkTypePrimary})
+				}
+			case atom.Link:
+				if href, ok := attr(token, "href"); ok {
+					links = append(links, Link{URL: href, Type: LinkTypeRelated})
+				}
+			case atom.Img, atom.Script, atom.Iframe:
+				if src, ok := attr(token, "src"); ok {
+					links = append(links, Link{URL: src, Type: LinkTypeRelated})
+				}
+			case atom.Style:
+				inStyle = token.Type == html.StartTagToken
+				style.Reset()
+			}
+		case html.TextToken:
+			if inStyle {
+				style.WriteString(token.Data)
+			}
+		case html.EndTagToken:
+			if token.DataAtom == atom.Style {
+				links = append(links, extractCSSLinks(style.Bytes())...)
+				inStyle = false
+			}
+		}
+	}
+	return links
+}
+
+// extractCSSLinks pulls url(...) references out of a CSS document, tagging
+// each as a related asset
+func extractCSSLinks(body []byte) []Link {
+	links := make([]Link, 0)
+	for _, m := range cssURLPattern.FindAllSubmatch(body, -1) {
+		links = append(links, Link{URL: string(m[1]), Type: LinkTypeRelated})
+	}
+	return links
+}
+
+func attr(t html.Token, key string) (string, bool) {
+	for _, a := range t.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,75 @@
+package crawler
+
+import "testing"
+
+func TestExtractHTMLLinks(t *testing.T) {
+	body := []byte(`<html><body>
+<a href="/page2">next</a>
+<link rel="stylesheet" href="/style.css">
+<img src="/logo.png">
+<script src="/app.js"></script>
+<style>body { background: url('/bg.png'); }</style>
+</body></html>`)
+
+	links := extractHTMLLinks(body)
+
+	want := map[string]LinkType{
+		"/page2":     LinkTypePrimary,
+		"/style.css": LinkTypeRelated,
+		"/logo.png":  LinkTypeRelated,
+		"/app.js":    LinkTypeRelated,
+		"/bg.png":    LinkTypeRelated,
+	}
+	if len(links) != len(want) {
+		t.Fatalf("want %d links, got %d: %+v", len(want), len(links), links)
+	}
+	for _, l := range links {
+		typ, ok := want[l.URL]
+		if !ok {
+			t.Errorf("unexpected link %q", l.URL)
+			continue
+		}
+		if typ != l.Type {
+			t.Errorf("link %q: want type %v, got %v", l.URL, typ, l.Type)
+		}
+	}
+}
+
+func TestExtractCSSLinks(t *testing.T) {
+	body := []byte(`
+@import url("reset.css");
+.hero { background-image: url('hero.jpg'); }
+.icon { background: url(icon.png) no-repeat; }
+`)
+
+	links := extractCSSLinks(body)
+
+	want := []string{"reset.css", "hero.jpg", "icon.png"}
+	if len(links) != len(want) {
+		t.Fatalf("want %d links, got %d: %+v", len(want), len(links), links)
+	}
+	for i, l := range links {
+		if l.URL != want[i] {
+			t.Errorf("link %d: want %q, got %q", i, want[i], l.URL)
+		}
+		if l.Type != LinkTypeRelated {
+			t.Errorf("link %d: want LinkTypeRelated, got %v", i, l.Type)
+		}
+	}
+}
+
+func TestDefaultExtractorDispatchesOnContentType(t *testing.T) {
+	ext := NewLinkExtractor()
+
+	css := []byte(`.icon { background: url(icon.png); }`)
+	links := ext.Extract(css, "text/css; charset=utf-8")
+	if len(links) != 1 || links[0].URL != "icon.png" {
+		t.Fatalf("want a single icon.png link from a text/css body, got %+v", links)
+	}
+
+	html := []byte(`<a href="/page">hi</a>`)
+	links = ext.Extract(html, "text/html; charset=utf-8")
+	if len(links) != 1 || links[0].URL != "/page" {
+		t.Fatalf("want a single /page link from a text/html body, got %+v", links)
+	}
+}
@@ -0,0 +1,203 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// NodeMeta is the per-node metadata carried alongside the graph edges:
+// everything a consumer needs to weigh or annotate a node in Gephi,
+// Cytoscape, or any other tool that reads one of the Marshal formats
+type NodeMeta struct {
+	URL         string
+	InDegree    int
+	OutDegree   int
+	Status      int
+	ContentType string
+	Bytes       int64
+	PageRank    float64
+}
+
+// Marshal writes the crawl graph to w in the given format: "dot" (the
+// historical default), "graphml", "gexf", or "json"
+func (c *Crawler) Marshal(w io.Writer, format string) error {
+	switch format {
+	case "", "dot":
+		return c.marshalDot(w)
+	case "graphml":
+		return c.marshalGraphML(w)
+	case "gexf":
+		return c.marshalGEXF(w)
+	case "json":
+		return c.marshalJSON(w)
+	default:
+		return fmt.Errorf("crawler: unknown output format %q", format)
+	}
+}
+
+// nodeIDs assigns every node an "N<n>" identifier, used by the graph-file
+// formats that don't accept arbitrary strings as node ids. Numbering follows
+// map iteration order, so ids are consistent within one Marshal call but
+// not from one call to the next
+func (c *Crawler) nodeIDs() map[string]string {
+	ids := make(map[string]string, len(c.Results))
+	count := 0
+	for url := range c.Results {
+		ids[url] = fmt.Sprintf("N%d", count)
+		count++
+	}
+	return ids
+}
+
+func (c *Crawler) metaFor(url string) *NodeMeta {
+	if meta, ok := c.Meta[url]; ok && meta != nil {
+		return meta
+	}
+	return &NodeMeta{URL: url}
+}
+
+func (c *Crawler) marshalDot(w io.Writer) error {
+	ids := c.nodeIDs()
+	if _, err := fmt.Fprint(w, "digraph Scraped {\n"); err != nil {
+		return err
+	}
+	for url, id := range ids {
+		meta := c.metaFor(url)
+		if _, err := fmt.Fprintf(w, "\t%s [label=%q pagerank=%q];\n", id, url, fmt.Sprintf("%.6f", meta.PageRank)); err != nil {
+			return err
+		}
+	}
+	for url, links := range c.Results {
+		source := ids[url]
+		for _, dest := range links {
+			if destID, ok := ids[dest]; ok {
+				if _, err := fmt.Fprintf(w, "\t%s -> %s; \n", source, destID); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	_, err := fmt.Fprint(w, "}\n")
+	return err
+}
+
+func (c *Crawler) marshalGraphML(w io.Writer) error {
+	ids := c.nodeIDs()
+	b := bufio.NewWriter(w)
+
+	fmt.Fprint(b, xml.Header)
+	fmt.Fprintln(b, `<graphml xmlns="http://graphml.graphdrawing.org/xmlns">`)
+	fmt.Fprintln(b, `  <key id="url" for="node" attr.name="url" attr.type="string"/>`)
+	fmt.Fprintln(b, `  <key id="pagerank" for="node" attr.name="pagerank" attr.type="double"/>`)
+	fmt.Fprintln(b, `  <graph edgedefault="directed">`)
+
+	for url, id := range ids {
+		meta := c.metaFor(url)
+		fmt.Fprintf(b, "    <node id=%q>\n", id)
+		fmt.Fprintf(b, "      <data key=\"url\">%s</data>\n", xmlEscape(url))
+		fmt.Fprintf(b, "      <data key=\"pagerank\">%f</data>\n", meta.PageRank)
+		fmt.Fprintln(b, "    </node>")
+	}
+
+	edgeID := 0
+	for url, links := range c.Results {
+		source := ids[url]
+		for _, dest := range links {
+			destID, ok := ids[dest]
+			if !ok {
+				continue
+			}
+			fmt.Fprintf(b, "    <edge id=\"e%d\" source=%q target=%q/>\n", edgeID, source, destID)
+			edgeID++
+		}
+	}
+
+	fmt.Fprintln(b, "  </graph>")
+	fmt.Fprintln(b, "</graphml>")
+	return b.Flush()
+}
+
+func (c *Crawler) marshalGEXF(w io.Writer) error {
+	ids := c.nodeIDs()
+	b := bufio.NewWriter(w)
+
+	fmt.Fprint(b, xml.Header)
+	fmt.Fprintln(b, `<gexf xmlns="http://www.gexf.net/1.2draft" version="1.2">`)
+	fmt.Fprintln(b, `  <graph mode="static" defaultedgetype="directed">`)
+	fmt.Fprintln(b, `    <attributes class="node">`)
+	fmt.Fprintln(b, `      <attribute id="0" title="pagerank" type="double"/>`)
+	fmt.Fprintln(b, `    </attributes>`)
+	fmt.Fprintln(b, "    <nodes>")
+	for url, id := range ids {
+		meta := c.metaFor(url)
+		fmt.Fprintf(b, "      <node id=%q label=\"%s\">\n", id, xmlEscape(url))
+		fmt.Fprintln(b, "        <attvalues>")
+		fmt.Fprintf(b, "          <attvalue for=\"0\" value=%q/>\n", fmt.Sprintf("%f", meta.PageRank))
+		fmt.Fprintln(b, "        </attvalues>")
+		fmt.Fprintln(b, "      </node>")
+	}
+	fmt.Fprintln(b, "    </nodes>")
+
+	fmt.Fprintln(b, "    <edges>")
+	edgeID := 0
+	for url, links := range c.Results {
+		source := ids[url]
+		for _, dest := range links {
+			destID, ok := ids[dest]
+			if !ok {
+				continue
+			}
+			fmt.Fprintf(b, "      <edge id=\"%d\" source=%q target=%q/>\n", edgeID, source, destID)
+			edgeID++
+		}
+	}
+	fmt.Fprintln(b, "    </edges>")
+
+	fmt.Fprintln(b, "  </graph>")
+	fmt.Fprintln(b, "</gexf>")
+	return b.Flush()
+}
+
+// jsonNode is one entry of the "json" format: an adjacency-list node
+// carrying the full NodeMeta; the dot, graphml and gexf formats only expose
+// each node's URL and PageRank
+type jsonNode struct {
+	URL         string   `json:"url"`
+	Links       []string `json:"links"`
+	InDegree    int      `json:"in_degree"`
+	OutDegree   int      `json:"out_degree"`
+	Status      int      `json:"status,omitempty"`
+	ContentType string   `json:"content_type,omitempty"`
+	Bytes       int64    `json:"bytes,omitempty"`
+	PageRank    float64  `json:"page_rank"`
+}
+
+func (c *Crawler) marshalJSON(w io.Writer) error {
+	nodes := make([]jsonNode, 0, len(c.Results))
+	for url, links := range c.Results {
+		meta := c.metaFor(url)
+		nodes = append(nodes, jsonNode{
+			URL:         url,
+			Links:       links,
+			InDegree:    meta.InDegree,
+			OutDegree:   meta.OutDegree,
+			Status:      meta.Status,
+			ContentType: meta.ContentType,
+			Bytes:       meta.Bytes,
+			PageRank:    meta.PageRank,
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(nodes)
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
@@ -0,0 +1,60 @@
+package crawler
+
+const (
+	pageRankDamping       = 0.85
+	pageRankMaxIterations = 100
+	pageRankTolerance     = 1e-6
+)
+
+// pageRank runs standard power-iteration PageRank over graph (node -> its
+// outbound neighbours), starting every node at 1/N and iterating until the
+// L1 delta across all nodes drops below pageRankTolerance or
+// pageRankMaxIterations have run
+func pageRank(graph map[string][]string) map[string]float64 {
+	n := len(graph)
+	if n == 0 {
+		return map[string]float64{}
+	}
+
+	rank := make(map[string]float64, n)
+	outDegree := make(map[string]int, n)
+	for node, out := range graph {
+		rank[node] = 1 / float64(n)
+		outDegree[node] = len(out)
+	}
+
+	//invert the graph once so each iteration can sum inbound contributions
+	inbound := make(map[string][]string, n)
+	for node, out := range graph {
+		for _, dest := range out {
+			inbound[dest] = append(inbound[dest], node)
+		}
+	}
+
+	for i := 0; i < pageRankMaxIterations; i++ {
+		next := make(map[string]float64, n)
+		delta := 0.0
+		for node := range graph {
+			sum := 0.0
+			for _, q := range inbound[node] {
+				if outDegree[q] > 0 {
+					sum += rank[q] / float64(outDegree[q])
+				}
+			}
+			next[node] = (1-pageRankDamping)/float64(n) + pageRankDamping*sum
+			delta += absFloat(next[node] - rank[node])
+		}
+		rank = next
+		if delta < pageRankTolerance {
+			break
+		}
+	}
+	return rank
+}
+
+func absFloat(f float64) float64 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
@@ -0,0 +1,46 @@
+package crawler
+
+import "testing"
+
+func TestPageRankEmptyGraph(t *testing.T) {
+	rank := pageRank(map[string][]string{})
+	if len(rank) != 0 {
+		t.Fatalf("want empty rank map, got %v", rank)
+	}
+}
+
+func TestPageRankRanksLinkedPageHigher(t *testing.T) {
+	// a and b both link to c, c links nowhere: c should end up with the
+	// highest rank and a, b should come out equal to each other
+	graph := map[string][]string{
+		"a": {"c"},
+		"b": {"c"},
+		"c": {},
+	}
+	rank := pageRank(graph)
+	if len(rank) != 3 {
+		t.Fatalf("want 3 ranked nodes, got %d", len(rank))
+	}
+	if rank["c"] <= rank["a"] || rank["c"] <= rank["b"] {
+		t.Fatalf("want c ranked above a and b, got a=%f b=%f c=%f", rank["a"], rank["b"], rank["c"])
+	}
+	if absFloat(rank["a"]-rank["b"]) > 1e-9 {
+		t.Fatalf("want a and b ranked equally, got a=%f b=%f", rank["a"], rank["b"])
+	}
+}
+
+func TestPageRankConverges(t *testing.T) {
+	// a simple cycle should settle with every node ranked equally
+	graph := map[string][]string{
+		"a": {"b"},
+		"b": {"c"},
+		"c": {"a"},
+	}
+	rank := pageRank(graph)
+	want := 1.0 / 3.0
+	for node, r := range rank {
+		if absFloat(r-want) > 1e-4 {
+			t.Fatalf("node %s: want rank near %f, got %f", node, want, r)
+		}
+	}
+}
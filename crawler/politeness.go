@@ -0,0 +1,176 @@
+package crawler
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CrawlSettings configures how politely the crawler behaves towards the
+// hosts it fetches from
+type CrawlSettings struct {
+	UserAgent       string        //sent as the User-Agent header on every request
+	FetchTimeout    time.Duration //per-request timeout on the underlying http.Client
+	PolitenessDelay time.Duration //minimum gap between requests to the same host
+	RespectRobots   bool          //honor robots.txt Disallow and Crawl-delay rules
+	MaxBodyBytes    int64         //cap on how much of a response body is read
+}
+
+// DefaultCrawlSettings returns a reasonably polite set of defaults
+func DefaultCrawlSettings() CrawlSettings {
+	return CrawlSettings{
+		UserAgent:       "go-grapher/1.0 (+https://github.com/Binaryblade/go-grapher)",
+		FetchTimeout:    30 * time.Second,
+		PolitenessDelay: 0,
+		RespectRobots:   true,
+		MaxBodyBytes:    1 << 20, // 1 MiB
+	}
+}
+
+// robotsPolicy is the subset of a robots.txt we honor: Disallow prefixes and
+// a Crawl-delay, both scoped to the "User-agent: *" group
+type robotsPolicy struct {
+	Disallow   []string
+	CrawlDelay time.Duration
+}
+
+func (p *robotsPolicy) allows(path string) bool {
+	for _, rule := range p.Disallow {
+		if strings.HasPrefix(path, rule) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseRobots reads a robots.txt body and extracts the "User-agent: *" group
+func parseRobots(r io.Reader) *robotsPolicy {
+	pol := &robotsPolicy{}
+	applies := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		val := strings.TrimSpace(parts[1])
+		switch key {
+		case "user-agent":
+			applies = val == "*"
+		case "disallow":
+			if applies && val != "" {
+				pol.Disallow = append(pol.Disallow, val)
+			}
+		case "crawl-delay":
+			if applies {
+				if secs, err := strconv.ParseFloat(val, 64); err == nil {
+					pol.CrawlDelay = time.Duration(secs * float64(time.Second))
+				}
+			}
+		}
+	}
+	return pol
+}
+
+// politeness enforces a per-host token-bucket delay and a cached robots.txt
+// policy, shared by every worker goroutine
+type politeness struct {
+	mu        sync.Mutex
+	lastHit   map[string]time.Time
+	robots    map[string]*robotsPolicy
+	client    *http.Client
+	userAgent string
+	baseDelay time.Duration
+	respect   bool
+}
+
+func newPoliteness(client *http.Client, settings CrawlSettings) *politeness {
+	return &politeness{
+		lastHit:   make(map[string]time.Time),
+		robots:    make(map[string]*robotsPolicy),
+		client:    client,
+		userAgent: settings.UserAgent,
+		baseDelay: settings.PolitenessDelay,
+		respect:   settings.RespectRobots,
+	}
+}
+
+// Wait blocks, if necessary, until it is polite to hit host again
+func (p *politeness) Wait(host string) {
+	p.mu.Lock()
+	delay := p.baseDelay
+	if pol, ok := p.robots[host]; ok && pol.CrawlDelay > delay {
+		delay = pol.CrawlDelay
+	}
+	next := time.Now()
+	if last, seen := p.lastHit[host]; seen && last.Add(delay).After(next) {
+		next = last.Add(delay)
+	}
+	p.lastHit[host] = next //reserve the slot so concurrent callers queue behind it
+	p.mu.Unlock()
+
+	if wait := time.Until(next); wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// Allowed reports whether rawurl may be fetched under the cached robots.txt
+// policy for its host. Always true when RespectRobots is disabled
+func (p *politeness) Allowed(rawurl string) bool {
+	if !p.respect {
+		return true
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return true
+	}
+	return p.policyFor(u).allows(u.Path)
+}
+
+func (p *politeness) policyFor(u *url.URL) *robotsPolicy {
+	p.mu.Lock()
+	pol, ok := p.robots[u.Host]
+	p.mu.Unlock()
+	if ok {
+		return pol
+	}
+
+	pol = p.fetchRobots(u)
+
+	p.mu.Lock()
+	p.robots[u.Host] = pol
+	p.mu.Unlock()
+	return pol
+}
+
+// fetchRobots fetches and parses /robots.txt for u's host; any failure is
+// treated as an empty (allow-all) policy. policyFor caches the result per
+// host, but callers that miss the cache at the same moment each fetch it
+func (p *politeness) fetchRobots(u *url.URL) *robotsPolicy {
+	robotsURL := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+	req, err := http.NewRequest("GET", robotsURL.String(), nil)
+	if err != nil {
+		return &robotsPolicy{}
+	}
+	req.Header.Set("User-Agent", p.userAgent)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return &robotsPolicy{}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &robotsPolicy{}
+	}
+	return parseRobots(resp.Body)
+}
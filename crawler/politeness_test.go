@@ -0,0 +1,56 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRobotsDisallowAndCrawlDelay(t *testing.T) {
+	body := `
+User-agent: *
+Disallow: /private
+Disallow: /tmp
+Crawl-delay: 2
+
+User-agent: other-bot
+Disallow: /everything
+`
+	pol := parseRobots(strings.NewReader(body))
+	if len(pol.Disallow) != 2 || pol.Disallow[0] != "/private" || pol.Disallow[1] != "/tmp" {
+		t.Fatalf("want Disallow [/private /tmp], got %v", pol.Disallow)
+	}
+	if pol.CrawlDelay != 2*time.Second {
+		t.Fatalf("want a 2s crawl delay, got %v", pol.CrawlDelay)
+	}
+}
+
+func TestParseRobotsIgnoresOtherUserAgents(t *testing.T) {
+	body := `
+User-agent: other-bot
+Disallow: /everything
+`
+	pol := parseRobots(strings.NewReader(body))
+	if len(pol.Disallow) != 0 {
+		t.Fatalf("want no rules picked up from a non-* group, got %v", pol.Disallow)
+	}
+}
+
+func TestRobotsPolicyAllows(t *testing.T) {
+	pol := &robotsPolicy{Disallow: []string{"/private", "/tmp"}}
+
+	cases := []struct {
+		path string
+		want bool
+	}{
+		{"/public/page", true},
+		{"/private", false},
+		{"/private/nested", false},
+		{"/tmp/file", false},
+	}
+	for _, c := range cases {
+		if got := pol.allows(c.path); got != c.want {
+			t.Errorf("allows(%q) = %v, want %v", c.path, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Package store persists crawl state to an embedded BoltDB file so a
+// Crawler can be interrupted and resumed without losing the pending queue
+// or the per-page results gathered so far.
+package store
+
+import (
+	"encoding/json"
+
+	"github.com/boltdb/bolt"
+)
+
+var (
+	pendingBucket = []byte("pending")
+	resultsBucket = []byte("results")
+	metaBucket    = []byte("meta")
+)
+
+// domainKey is the meta bucket key the crawl's base domain is saved under,
+// so a resumed crawl can recover it without a positional basehost argument
+var domainKey = []byte("domain")
+
+// Store wraps a BoltDB handle and exposes the buckets the crawler needs
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens (or creates) the BoltDB file at path and ensures the buckets
+// used by the crawler exist
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{pendingBucket, resultsBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Close releases the underlying BoltDB file
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// QueueItem is a pending crawl request, persisted so it survives a restart.
+// LinkType mirrors crawler.LinkType without importing it, to keep store
+// free of a dependency on the crawler package
+type QueueItem struct {
+	URL      string
+	Depth    int
+	LinkType int
+}
+
+// Enqueue persists a pending request
+func (s *Store) Enqueue(item QueueItem) error {
+	buf, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(pendingBucket).Put([]byte(item.URL), buf)
+	})
+}
+
+// Dequeue removes a pending request once a worker has handled it
+func (s *Store) Dequeue(url string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(pendingBucket).Delete([]byte(url))
+	})
+}
+
+// Pending returns every request still queued, used to resume a crawl
+func (s *Store) Pending() ([]QueueItem, error) {
+	var items []QueueItem
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(pendingBucket).ForEach(func(k, v []byte) error {
+			var item QueueItem
+			if err := json.Unmarshal(v, &item); err != nil {
+				return err
+			}
+			items = append(items, item)
+			return nil
+		})
+	})
+	return items, err
+}
+
+// SaveResult stores the links found on a page so it need not be rescraped
+func (s *Store) SaveResult(url string, links []string) error {
+	buf, err := json.Marshal(links)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(resultsBucket).Put([]byte(url), buf)
+	})
+}
+
+// SaveDomain persists the crawl's base domain so a later -resume, run
+// without a positional basehost, can recover it
+func (s *Store) SaveDomain(domain string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(metaBucket).Put(domainKey, []byte(domain))
+	})
+}
+
+// Domain returns the base domain saved by SaveDomain, or "" if none was
+func (s *Store) Domain() (string, error) {
+	var domain string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(metaBucket).Get(domainKey); v != nil {
+			domain = string(v)
+		}
+		return nil
+	})
+	return domain, err
+}
+
+// Results returns every page result recorded so far, keyed by URL
+func (s *Store) Results() (map[string][]string, error) {
+	results := make(map[string][]string)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(resultsBucket).ForEach(func(k, v []byte) error {
+			var links []string
+			if err := json.Unmarshal(v, &links); err != nil {
+				return err
+			}
+			results[string(k)] = links
+			return nil
+		})
+	})
+	return results, err
+}
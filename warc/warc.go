@@ -0,0 +1,61 @@
+// Package warc writes gzipped WARC 1.0 "response" records so a crawl can
+// archive the raw HTTP traffic behind every page it visits.
+package warc
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Writer appends gzipped WARC 1.0 response records to an underlying io.Writer
+type Writer struct {
+	gz *gzip.Writer
+}
+
+// NewWriter wraps w with a WARC writer. Call Close to flush the gzip stream;
+// the caller remains responsible for closing w itself
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{gz: gzip.NewWriter(w)}
+}
+
+// WriteResponse appends a "response" record for targetURI, embedding raw as
+// produced by httputil.DumpResponse(resp, true)
+func (wr *Writer) WriteResponse(targetURI string, raw []byte) error {
+	header := fmt.Sprintf(
+		"WARC/1.0\r\n"+
+			"WARC-Type: response\r\n"+
+			"WARC-Target-URI: %s\r\n"+
+			"WARC-Date: %s\r\n"+
+			"WARC-Record-ID: <urn:uuid:%s>\r\n"+
+			"Content-Type: application/http; msgtype=response\r\n"+
+			"Content-Length: %d\r\n\r\n",
+		targetURI, time.Now().UTC().Format(time.RFC3339), newRecordID(), len(raw))
+
+	bw := bufio.NewWriter(wr.gz)
+	if _, err := bw.WriteString(header); err != nil {
+		return err
+	}
+	if _, err := bw.Write(raw); err != nil {
+		return err
+	}
+	if _, err := bw.WriteString("\r\n\r\n"); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Close flushes and closes the gzip stream
+func (wr *Writer) Close() error {
+	return wr.gz.Close()
+}
+
+// newRecordID produces a WARC-Record-ID good enough to be unique per record
+func newRecordID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return fmt.Sprintf("%x-%x-%x-%x-%x", buf[0:4], buf[4:6], buf[6:8], buf[8:10], buf[10:16])
+}